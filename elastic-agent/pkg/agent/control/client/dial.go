@@ -24,16 +24,25 @@ import (
 	"net"
 	"strings"
 
-	"github.com/elastic/elastic-agent-poc/elastic-agent/pkg/agent/control"
-
 	"google.golang.org/grpc"
 )
 
-func dialContext(ctx context.Context) (*grpc.ClientConn, error) {
-	return grpc.DialContext(ctx, strings.TrimPrefix(control.Address(), "unix://"), grpc.WithInsecure(), grpc.WithContextDialer(dialer))
+func dialContext(ctx context.Context, options *dialOptions) (*grpc.ClientConn, error) {
+	creds := options.credentials()
+
+	if options.transport == TransportTCP {
+		return grpc.DialContext(ctx, strings.TrimPrefix(options.address, "tcp://"), grpc.WithTransportCredentials(creds))
+	}
+
+	return grpc.DialContext(
+		ctx,
+		strings.TrimPrefix(options.address, "unix://"),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(unixDialer),
+	)
 }
 
-func dialer(ctx context.Context, addr string) (net.Conn, error) {
+func unixDialer(ctx context.Context, addr string) (net.Conn, error) {
 	var d net.Dialer
 	return d.DialContext(ctx, "unix", addr)
-}
\ No newline at end of file
+}
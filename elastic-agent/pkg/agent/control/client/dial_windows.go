@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build windows
+
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+
+	"google.golang.org/grpc"
+)
+
+func dialContext(ctx context.Context, options *dialOptions) (*grpc.ClientConn, error) {
+	creds := options.credentials()
+
+	if options.transport == TransportTCP {
+		return grpc.DialContext(ctx, strings.TrimPrefix(options.address, "tcp://"), grpc.WithTransportCredentials(creds))
+	}
+
+	return grpc.DialContext(
+		ctx,
+		strings.TrimPrefix(options.address, "npipe://"),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(namedPipeDialer),
+	)
+}
+
+func namedPipeDialer(ctx context.Context, addr string) (net.Conn, error) {
+	timeout := 2 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	return winio.DialPipe(addr, &timeout)
+}
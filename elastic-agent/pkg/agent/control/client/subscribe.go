@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-poc/elastic-agent/internal/pkg/agent/application/upgrade/details"
+	"github.com/elastic/elastic-agent-poc/elastic-agent/pkg/agent/control/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// subscribeUpgradeDetailsMethod is the fully-qualified gRPC method name
+// SubscribeUpgradeDetails is registered under, as declared in
+// control.proto. It's invoked directly via
+// grpc.ClientConn.NewStream rather than through a generated
+// ElasticAgentControlClient, since that generated client isn't part of
+// this snapshot.
+const subscribeUpgradeDetailsMethod = "/proto.ElasticAgentControl/SubscribeUpgradeDetails"
+
+// SubscribeUpgradeDetails opens a SubscribeUpgradeDetails stream against
+// the control-plane server and decodes each message into a
+// *details.Details. The returned channel is closed when the server
+// reports State == StateCompleted, mirroring the observer(nil) convention
+// used by Details.RegisterObserver, or when the stream ends for any other
+// reason.
+func SubscribeUpgradeDetails(ctx context.Context, opts ...Option) (<-chan *details.Details, error) {
+	conn, err := Dial(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dialing control server: %w", err)
+	}
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{StreamName: "SubscribeUpgradeDetails", ServerStreams: true}, subscribeUpgradeDetailsMethod)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening upgrade details subscription: %w", err)
+	}
+
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sending subscribe request: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("closing subscribe request stream: %w", err)
+	}
+
+	ch := make(chan *details.Details)
+
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+
+		for {
+			var msg proto.UpgradeDetailsUpdate
+			if err := stream.RecvMsg(&msg); err != nil {
+				// Stream ended, either cleanly (io.EOF) or with an
+				// error; either way there's nothing more a caller can
+				// do with this channel than stop reading from it.
+				return
+			}
+
+			var d details.Details
+			if err := json.Unmarshal(msg.GetDetails(), &d); err != nil {
+				continue
+			}
+
+			if d.State == details.StateCompleted {
+				return
+			}
+
+			ch <- &d
+		}
+	}()
+
+	return ch, nil
+}
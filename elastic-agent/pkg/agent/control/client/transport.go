@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elastic/elastic-agent-poc/elastic-agent/pkg/agent/control"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Transport identifies which network transport Dial uses to reach the
+// control-plane server.
+type Transport int
+
+const (
+	// transportAuto selects a transport based on the scheme of
+	// control.Address(), so callers don't need to know which platform
+	// they're running on. This is the default.
+	transportAuto Transport = iota
+
+	// TransportUnix dials a Unix domain socket (unix:// addresses). On
+	// Windows it is dialed as a named pipe, like TransportNamedPipe.
+	TransportUnix
+
+	// TransportNamedPipe dials a Windows named pipe (npipe:// addresses).
+	// On other platforms it is dialed as a Unix domain socket, like
+	// TransportUnix.
+	TransportNamedPipe
+
+	// TransportTCP dials a TCP address (tcp:// addresses).
+	TransportTCP
+)
+
+// dialOptions holds the resolved configuration for a single Dial call.
+type dialOptions struct {
+	address   string
+	transport Transport
+	tlsConfig *tls.Config
+}
+
+// Option configures a Dial call.
+type Option func(*dialOptions)
+
+// WithTransport forces Dial to use a specific transport instead of
+// inferring one from the control.Address() scheme.
+func WithTransport(t Transport) Option {
+	return func(o *dialOptions) {
+		o.transport = t
+	}
+}
+
+// WithTLSConfig enables mTLS on the dial, using tlsConfig in place of an
+// insecure connection. Use LoadTLSConfig to build tlsConfig from the
+// certificate/key pair the agent writes into its data directory at
+// install time.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *dialOptions) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// LoadTLSConfig builds a client-side mTLS tls.Config from a certificate/key
+// pair and the CA that issued the server's certificate.
+func LoadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading control client certificate: %w", err)
+	}
+
+	caBytes, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading control CA certificate: %w", err)
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Dial connects to the control-plane server at control.Address(). The
+// transport is inferred from the address scheme (unix://, npipe://,
+// tcp://) unless overridden with WithTransport. The connection is
+// unauthenticated unless WithTLSConfig is supplied.
+func Dial(ctx context.Context, opts ...Option) (*grpc.ClientConn, error) {
+	options := &dialOptions{address: control.Address()}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.transport == transportAuto {
+		options.transport = transportFromAddress(options.address)
+	}
+
+	return dialContext(ctx, options)
+}
+
+func transportFromAddress(address string) Transport {
+	switch {
+	case strings.HasPrefix(address, "npipe://"):
+		return TransportNamedPipe
+	case strings.HasPrefix(address, "tcp://"):
+		return TransportTCP
+	default:
+		return TransportUnix
+	}
+}
+
+func (o *dialOptions) credentials() credentials.TransportCredentials {
+	if o.tlsConfig != nil {
+		return credentials.NewTLS(o.tlsConfig)
+	}
+
+	return insecure.NewCredentials()
+}
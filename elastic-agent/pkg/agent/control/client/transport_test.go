@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportFromAddress(t *testing.T) {
+	cases := []struct {
+		name    string
+		address string
+		want    Transport
+	}{
+		{"named pipe", "npipe://./pipe/elastic-agent-control", TransportNamedPipe},
+		{"tcp", "tcp://localhost:6788", TransportTCP},
+		{"unix", "unix:///var/run/elastic-agent.sock", TransportUnix},
+		{"defaults to unix", "/var/run/elastic-agent.sock", TransportUnix},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.want, transportFromAddress(c.address))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Code generated by protoc-gen-go from control.proto's UpgradeDetailsUpdate
+// message would normally live here. It's hand-written in this snapshot
+// because the rest of the generated control.pb.go isn't part of this
+// tree; regenerating from control.proto should replace this file.
+
+package proto
+
+// UpgradeDetailsUpdate carries a single upgrade details.Details update,
+// streamed by the SubscribeUpgradeDetails RPC.
+type UpgradeDetailsUpdate struct {
+	// Details is the JSON encoding of a details.Details value.
+	Details []byte
+}
+
+func (m *UpgradeDetailsUpdate) Reset()         { *m = UpgradeDetailsUpdate{} }
+func (m *UpgradeDetailsUpdate) String() string { return string(m.Details) }
+func (*UpgradeDetailsUpdate) ProtoMessage()    {}
+
+// GetDetails returns m.Details, or nil if m is nil.
+func (m *UpgradeDetailsUpdate) GetDetails() []byte {
+	if m == nil {
+		return nil
+	}
+	return m.Details
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package control
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewPeerCredListener wraps a Unix domain socket listener so the control
+// gRPC server rejects, at accept time, any caller whose uid doesn't match
+// the agent's own install uid. Use it in place of the raw listener
+// returned by net.Listen("unix", ...) when serving the control socket.
+func NewPeerCredListener(l net.Listener) net.Listener {
+	return &peerCredListener{Listener: l}
+}
+
+type peerCredListener struct {
+	net.Listener
+}
+
+// Accept blocks until it can return a connection whose peer uid matches
+// this process's uid, transparently rejecting (and closing) any others.
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := verifyPeerUID(conn); err != nil {
+			conn.Close()
+			continue
+		}
+
+		return conn, nil
+	}
+}
+
+// verifyPeerUID uses SO_PEERCRED to confirm that the process on the other
+// end of conn is running as this one's uid, so the control server can
+// reject callers that shouldn't have access to the local control socket.
+func verifyPeerUID(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("getting raw control socket connection: %w", err)
+	}
+
+	var ucred *unix.Ucred
+	var ucredErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, ucredErr = unix.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return fmt.Errorf("reading SO_PEERCRED from control socket: %w", err)
+	}
+	if ucredErr != nil {
+		return fmt.Errorf("reading SO_PEERCRED from control socket: %w", ucredErr)
+	}
+
+	if agentUID := os.Getuid(); int(ucred.Uid) != agentUID {
+		return fmt.Errorf("control socket peer uid %d does not match agent uid %d", ucred.Uid, agentUID)
+	}
+
+	return nil
+}
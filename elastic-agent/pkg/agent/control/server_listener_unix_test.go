@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build linux
+
+package control
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPeerUIDAcceptsSameUID(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "control.sock")
+
+	l, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		conn, dialErr := net.Dial("unix", sockPath)
+		if dialErr == nil {
+			defer conn.Close()
+		}
+	}()
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Dialing our own listener from this same process means the peer's
+	// uid is always this process's uid.
+	require.NoError(t, verifyPeerUID(conn))
+}
+
+func TestVerifyPeerUIDSkipsNonUnixConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// verifyPeerUID only applies SO_PEERCRED checking to *net.UnixConn;
+	// anything else (e.g. an in-memory net.Pipe, used here to stand in
+	// for a transport SO_PEERCRED doesn't apply to) is left alone.
+	require.NoError(t, verifyPeerUID(server))
+}
+
+func TestPeerCredListenerAcceptsMatchingUID(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "control.sock")
+
+	rawListener, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	defer rawListener.Close()
+
+	l := NewPeerCredListener(rawListener)
+
+	go func() {
+		conn, dialErr := net.Dial("unix", sockPath)
+		if dialErr == nil {
+			defer conn.Close()
+		}
+	}()
+
+	// Our own process always matches its own uid, so the connection
+	// should be accepted rather than silently dropped and retried
+	// forever.
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	conn.Close()
+}
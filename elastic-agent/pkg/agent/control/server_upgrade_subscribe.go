@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/elastic/elastic-agent-poc/elastic-agent/internal/pkg/agent/application/upgrade/details"
+	"github.com/elastic/elastic-agent-poc/elastic-agent/pkg/agent/control/proto"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// upgradeDetailsSubscribeBuffer bounds how many undelivered updates a
+// single SubscribeUpgradeDetails stream buffers before the oldest is
+// dropped, so a slow client can't stall the upgrader.
+const upgradeDetailsSubscribeBuffer = 8
+
+// UpgradeDetailsProvider is implemented by whatever owns the active
+// upgrade's *details.Details, so Server doesn't need to reach into
+// upgrader internals directly.
+type UpgradeDetailsProvider interface {
+	// ActiveUpgradeDetails returns the *details.Details for the
+	// in-progress upgrade, or nil if no upgrade is running.
+	ActiveUpgradeDetails() *details.Details
+}
+
+// upgradeDetailsStream is the subset of the generated
+// ElasticAgentControl_SubscribeUpgradeDetailsServer that this handler
+// needs. It's satisfied by the real grpc server stream once the Go code
+// for control.proto's SubscribeUpgradeDetails is generated.
+type upgradeDetailsStream interface {
+	Send(*proto.UpgradeDetailsUpdate) error
+	Context() context.Context
+}
+
+// Server is the control-plane gRPC server. Only the field this handler
+// needs is declared here; Server's other RPC handlers predate this
+// change and aren't part of this snapshot.
+type Server struct {
+	UpgradeDetails UpgradeDetailsProvider
+}
+
+// SubscribeUpgradeDetails implements the SubscribeUpgradeDetails RPC. It
+// registers an Observer on the active upgrade's *details.Details via
+// Details.Subscribe — which already provides the bounded, drop-oldest
+// channel a slow subscriber needs — and forwards every notification to
+// stream until the upgrade completes or the stream's context is
+// canceled, unregistering the observer in both cases.
+func (s *Server) SubscribeUpgradeDetails(_ *emptypb.Empty, stream upgradeDetailsStream) error {
+	d := s.UpgradeDetails.ActiveUpgradeDetails()
+	if d == nil {
+		return nil
+	}
+
+	ch, unsubscribe := d.Subscribe(upgradeDetailsSubscribeBuffer)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case update, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			data, err := json.Marshal(update)
+			if err != nil {
+				return err
+			}
+
+			if err := stream.Send(&proto.UpgradeDetailsUpdate{Details: data}); err != nil {
+				return err
+			}
+		}
+	}
+}
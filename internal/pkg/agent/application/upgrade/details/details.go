@@ -5,9 +5,11 @@
 package details
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +17,22 @@ import (
 	"github.com/docker/go-units"
 )
 
+// NumericDownloadRate, when set to true, causes downloadRate to be marshaled
+// as a plain JSON number of bytes/second instead of the default
+// human-readable string (e.g. "1.5 MBps"). Some downstream systems parse
+// download_rate strictly as a number and reject the humanized form.
+//
+// This is a package-level switch rather than a per-Details option because
+// the marshaling behavior is a property of the consumer reading the JSON,
+// not of any particular upgrade.
+var NumericDownloadRate = false
+
 // downloadRate is a float64 that can be safely marshalled to JSON
 // when the value is Infinity. The rate is always in bytes/second units.
+//
+// UnmarshalJSON accepts both the humanized string this package produces
+// (e.g. "1.5 MBps") and a raw JSON number in bytes/second, since older
+// agents and some Fleet-side consumers send the latter.
 type downloadRate float64
 
 // Observer is a function that will be called with upgrade details
@@ -29,8 +45,31 @@ type Details struct {
 	ActionID      string   `json:"action_id,omitempty" yaml:"action_id,omitempty"`
 	Metadata      Metadata `json:"metadata" yaml:"metadata"`
 
-	observers []Observer
-	mu        sync.Mutex
+	observers      []registeredObserver
+	nextObserverID int
+	mu             sync.Mutex
+
+	// downloadStarted records when the current download began, so that
+	// SetDownloadProgress can derive Metadata.DownloadETASeconds.
+	downloadStarted time.Time
+
+	// journal, if set via SetJournal, receives a record of every state
+	// transition so the upgrade can be resumed after a crash or restart.
+	journal *Journal
+
+	// retryPolicy, if set via SetRetryPolicy, is consulted by Fail to
+	// decide whether to transition to StateRetrying instead of
+	// StateFailed.
+	retryPolicy *RetryPolicy
+}
+
+// registeredObserver pairs an Observer with the id RegisterObserver handed
+// back to its caller, so that a single registration can later be removed
+// by UnregisterObserver without relying on comparing func values (which Go
+// doesn't support for closures in any useful way).
+type registeredObserver struct {
+	id int
+	fn Observer
 }
 
 // Metadata consists of metadata relating to a specific upgrade state
@@ -45,6 +84,12 @@ type Metadata struct {
 	// is progressing.
 	DownloadRate downloadRate `json:"download_rate,omitempty" yaml:"download_rate,omitempty"`
 
+	// DownloadETASeconds is the estimated number of seconds remaining
+	// before the download completes, derived from DownloadPercent and
+	// DownloadRate. It is only set once both of those have been recorded
+	// via SetDownloadProgress.
+	DownloadETASeconds *float64 `json:"eta_seconds,omitempty" yaml:"eta_seconds,omitempty"`
+
 	// FailedState is the state an upgrade was in if/when it failed. Use the
 	// Fail() method of UpgradeDetails to correctly record details when
 	// an upgrade fails.
@@ -54,6 +99,42 @@ type Metadata struct {
 	// the Fail() method of UpgradeDetails to correctly record details when
 	// an upgrade fails.
 	ErrorMsg string `json:"error_msg,omitempty" yaml:"error_msg,omitempty"`
+
+	// PauseReason is set by Pause to explain why the upgrade was paused,
+	// and cleared by Resume.
+	PauseReason string `json:"pause_reason,omitempty" yaml:"pause_reason,omitempty"`
+
+	// PrePauseState records the state Pause was called from, so Resume can
+	// restore it. It must be an exported, journaled field rather than an
+	// unexported Details field: if the agent crashes while paused, the
+	// journal is the only thing that lets a reloaded *Details resume to
+	// the correct state instead of an empty one.
+	PrePauseState State `json:"pre_pause_state,omitempty" yaml:"pre_pause_state,omitempty"`
+
+	// RetryAttempt is the number of the retry attempt currently scheduled
+	// or in progress. It is 0 until the first call to Retry.
+	RetryAttempt int `json:"retry_attempt,omitempty" yaml:"retry_attempt,omitempty"`
+
+	// RetryAt is when the next retry attempt is scheduled to begin.
+	RetryAt *time.Time `json:"retry_at,omitempty" yaml:"retry_at,omitempty"`
+
+	// RetryHistory accumulates a record of every retry attempt across the
+	// life of this upgrade. Unlike FailedState and ErrorMsg, it is not
+	// cleared by SetState on non-terminal transitions.
+	RetryHistory []RetryRecord `json:"retry_history,omitempty" yaml:"retry_history,omitempty"`
+
+	// DownloadBytesOffset is the number of bytes of the target artifact
+	// that have been downloaded so far. Unlike DownloadPercent, it is an
+	// absolute byte count, so a journaled Details can be used to resume a
+	// download with an HTTP Range request starting at this offset instead
+	// of re-downloading the whole artifact. Set via SetDownloadBytes.
+	DownloadBytesOffset int64 `json:"download_bytes_offset,omitempty" yaml:"download_bytes_offset,omitempty"`
+
+	// DownloadTotalBytes is the total size, in bytes, of the target
+	// artifact being downloaded, as reported alongside DownloadBytesOffset
+	// to SetDownloadBytes. It is required to make DownloadBytesOffset
+	// meaningful on its own once reloaded from the journal.
+	DownloadTotalBytes int64 `json:"download_total_bytes,omitempty" yaml:"download_total_bytes,omitempty"`
 }
 
 func NewDetails(targetVersion string, initialState State, actionID string) *Details {
@@ -62,10 +143,33 @@ func NewDetails(targetVersion string, initialState State, actionID string) *Deta
 		State:         initialState,
 		ActionID:      actionID,
 		Metadata:      Metadata{},
-		observers:     []Observer{},
 	}
 }
 
+// SetJournal attaches a Journal that will receive a record of every
+// subsequent state transition (SetState, SetDownloadProgress,
+// SetDownloadBytes, Fail, Pause, Resume, Retry), so the upgrade can be resumed after a crash or
+// restart. Journal write
+// errors are swallowed by design: losing resumability for this one
+// transition is preferable to letting a disk I/O error interrupt upgrade
+// progress reporting.
+func (d *Details) SetJournal(j *Journal) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.journal = j
+}
+
+// recordToJournal best-effort appends the current state to the attached
+// journal, if any. Callers must hold d.mu.
+func (d *Details) recordToJournal() {
+	if d.journal == nil {
+		return
+	}
+
+	_ = d.journal.Record(d)
+}
+
 // SetState is a convenience method to set the state of the upgrade and
 // notify all observers.
 // Do NOT call SetState with StateFailed; call the Fail method instead.
@@ -83,6 +187,7 @@ func (d *Details) SetState(s State) {
 		d.Metadata.FailedState = ""
 	}
 
+	d.recordToJournal()
 	d.notifyObservers()
 }
 
@@ -92,11 +197,51 @@ func (d *Details) SetDownloadProgress(percent, rateBytesPerSecond float64) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	if d.downloadStarted.IsZero() && percent > 0 {
+		d.downloadStarted = time.Now()
+	}
+
 	d.Metadata.DownloadPercent = percent
 	d.Metadata.DownloadRate = downloadRate(rateBytesPerSecond)
+	d.Metadata.DownloadETASeconds = etaSeconds(percent, rateBytesPerSecond, d.downloadStarted)
+
+	d.recordToJournal()
+	d.notifyObservers()
+}
+
+// SetDownloadBytes is a convenience method to record how many bytes of the
+// target artifact have been downloaded so far, out of total, when the
+// upgrade is in UPG_DOWNLOADING state. Unlike SetDownloadProgress's
+// percent, these are absolute byte counts, so that a journaled Details can
+// be used to resume the download with an HTTP Range request starting at
+// offset instead of restarting it from the beginning.
+func (d *Details) SetDownloadBytes(offset, total int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.Metadata.DownloadBytesOffset = offset
+	d.Metadata.DownloadTotalBytes = total
+
+	d.recordToJournal()
 	d.notifyObservers()
 }
 
+// etaSeconds derives the estimated number of seconds remaining in a
+// download from the time elapsed since it started and the fraction
+// (percent) completed in that time, assuming the average progress since
+// the start holds for the remainder. rateBytesPerSecond does not enter the
+// estimate; it returns nil unless percent is strictly between 0 and 1,
+// rateBytesPerSecond is positive and started is set.
+func etaSeconds(percent, rateBytesPerSecond float64, started time.Time) *float64 {
+	if percent <= 0 || percent >= 1 || rateBytesPerSecond <= 0 || started.IsZero() {
+		return nil
+	}
+
+	elapsed := time.Since(started).Seconds()
+	eta := elapsed * (1 - percent) / percent
+	return &eta
+}
+
 // Fail is a convenience method to set the state of the upgrade
 // to StateFailed, set metadata associated with the failure, and
 // notify all observers.
@@ -104,6 +249,19 @@ func (d *Details) Fail(err error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	errMsg := err.Error()
+
+	// If a RetryPolicy has been attached and still allows another
+	// attempt, retry instead of failing outright. This must be checked
+	// before FailedState is recorded below: StateRetrying isn't a
+	// terminal failure, so Metadata.FailedState must stay unset for it
+	// (retry clears it regardless, but there's no reason to set it here).
+	if d.retryPolicy != nil && d.Metadata.RetryAttempt < d.retryPolicy.MaxAttempts {
+		attempt := d.Metadata.RetryAttempt + 1
+		d.retry(attempt, d.retryPolicy.nextRetryAt(attempt), errMsg)
+		return
+	}
+
 	// Record the state the upgrade process was in right before it
 	// failed, but only do this if we haven't already transitioned the
 	// state to the StateFailed state; otherwise we'll just end up recording
@@ -112,20 +270,78 @@ func (d *Details) Fail(err error) {
 		d.Metadata.FailedState = d.State
 	}
 
-	d.Metadata.ErrorMsg = err.Error()
+	d.Metadata.ErrorMsg = errMsg
 	d.State = StateFailed
+	d.recordToJournal()
 	d.notifyObservers()
 }
 
 // RegisterObserver allows an interested consumer of Details to register
 // themselves as an Observer. The registered observer is immediately notified
-// of the current upgrade details.
-func (d *Details) RegisterObserver(observer Observer) {
+// of the current upgrade details. The returned id can be passed to
+// UnregisterObserver to stop further notifications.
+func (d *Details) RegisterObserver(observer Observer) int {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	d.observers = append(d.observers, observer)
+	d.nextObserverID++
+	id := d.nextObserverID
+
+	d.observers = append(d.observers, registeredObserver{id: id, fn: observer})
 	d.notifyObserver(observer)
+
+	return id
+}
+
+// UnregisterObserver removes the observer previously registered under id,
+// so it will no longer be notified of upgrade details changes. This is
+// needed by consumers whose lifetime may end before the upgrade itself
+// completes, such as a gRPC subscriber that cancels its stream.
+func (d *Details) UnregisterObserver(id int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, o := range d.observers {
+		if o.id == id {
+			d.observers = append(d.observers[:i], d.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Subscribe registers an Observer that forwards each notification onto a
+// channel of the given buffer size, and returns that channel along with an
+// unsubscribe function. If the channel is full when a notification
+// arrives, the oldest buffered notification is dropped to make room, so a
+// slow consumer — such as a gRPC client reading a SubscribeUpgradeDetails
+// stream — can't stall the rest of the upgrade. The channel is closed once
+// an observer receives nil, i.e. when State == StateCompleted (see the
+// notifyObserver convention).
+func (d *Details) Subscribe(bufferSize int) (ch <-chan *Details, unsubscribe func()) {
+	c := make(chan *Details, bufferSize)
+
+	var closeOnce sync.Once
+	id := d.RegisterObserver(func(details *Details) {
+		if details == nil {
+			closeOnce.Do(func() { close(c) })
+			return
+		}
+
+		for {
+			select {
+			case c <- details:
+				return
+			default:
+			}
+
+			select {
+			case <-c:
+			default:
+			}
+		}
+	})
+
+	return c, func() { d.UnregisterObserver(id) }
 }
 
 // Equals compares the non-lock fields of two Details structs.
@@ -148,7 +364,7 @@ func (d *Details) Equals(otherD *Details) bool {
 
 func (d *Details) notifyObservers() {
 	for _, observer := range d.observers {
-		d.notifyObserver(observer)
+		d.notifyObserver(observer.fn)
 	}
 }
 
@@ -171,7 +387,31 @@ func (m Metadata) Equals(otherM Metadata) bool {
 		m.FailedState == otherM.FailedState &&
 		m.ErrorMsg == otherM.ErrorMsg &&
 		m.DownloadPercent == otherM.DownloadPercent &&
-		m.DownloadRate == otherM.DownloadRate
+		m.DownloadRate == otherM.DownloadRate &&
+		equalFloat64Pointers(m.DownloadETASeconds, otherM.DownloadETASeconds) &&
+		m.DownloadBytesOffset == otherM.DownloadBytesOffset &&
+		m.DownloadTotalBytes == otherM.DownloadTotalBytes &&
+		m.PauseReason == otherM.PauseReason &&
+		m.PrePauseState == otherM.PrePauseState &&
+		m.RetryAttempt == otherM.RetryAttempt &&
+		equalTimePointers(m.RetryAt, otherM.RetryAt) &&
+		equalRetryHistories(m.RetryHistory, otherM.RetryHistory)
+}
+
+func equalRetryHistories(r, otherR []RetryRecord) bool {
+	if len(r) != len(otherR) {
+		return false
+	}
+
+	for i := range r {
+		if r[i].Attempt != otherR[i].Attempt ||
+			r[i].Error != otherR[i].Error ||
+			!r[i].RetryAt.Equal(otherR[i].RetryAt) {
+			return false
+		}
+	}
+
+	return true
 }
 
 func equalTimePointers(t, otherT *time.Time) bool {
@@ -185,18 +425,55 @@ func equalTimePointers(t, otherT *time.Time) bool {
 	return t.Equal(*otherT)
 }
 
+func equalFloat64Pointers(f, otherF *float64) bool {
+	if f == otherF {
+		return true
+	}
+	if f == nil || otherF == nil {
+		return false
+	}
+
+	return *f == *otherF
+}
+
 func (dr *downloadRate) MarshalJSON() ([]byte, error) {
 	downloadRateBytesPerSecond := float64(*dr)
+
+	// +Inf can't be represented as a JSON number, so it's always encoded
+	// as a string regardless of NumericDownloadRate.
 	if math.IsInf(downloadRateBytesPerSecond, 0) {
 		return json.Marshal("+Inf bps")
 	}
 
+	if NumericDownloadRate {
+		return json.Marshal(downloadRateBytesPerSecond)
+	}
+
 	return json.Marshal(
 		fmt.Sprintf("%sps", units.HumanSizeWithPrecision(downloadRateBytesPerSecond, 2)),
 	)
 }
 
 func (dr *downloadRate) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+
+	if string(trimmed) == "null" {
+		*dr = 0
+		return nil
+	}
+
+	if looksNumeric(trimmed) {
+		// strconv rather than json.Unmarshal, which rejects numbers with a
+		// leading '+' or '.' that looksNumeric lets through.
+		downloadRateBytesPerSecond, err := strconv.ParseFloat(string(trimmed), 64)
+		if err != nil {
+			return err
+		}
+
+		*dr = downloadRate(downloadRateBytesPerSecond)
+		return nil
+	}
+
 	var downloadRateStr string
 	err := json.Unmarshal(data, &downloadRateStr)
 	if err != nil {
@@ -217,3 +494,18 @@ func (dr *downloadRate) UnmarshalJSON(data []byte) error {
 	*dr = downloadRate(downloadRateBytesPerSecond)
 	return nil
 }
+
+// looksNumeric reports whether data is the JSON encoding of a number, as
+// opposed to a quoted string, by checking its first non-whitespace byte.
+func looksNumeric(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+
+	switch data[0] {
+	case '-', '+', '.', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	default:
+		return false
+	}
+}
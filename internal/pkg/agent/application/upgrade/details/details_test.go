@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package details
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRateUnmarshalJSON(t *testing.T) {
+	cases := map[string]struct {
+		data     string
+		expected downloadRate
+	}{
+		"integer":     {data: `1536000`, expected: downloadRate(1536000)},
+		"float":       {data: `1536000.5`, expected: downloadRate(1536000.5)},
+		"negative":    {data: `-1`, expected: downloadRate(-1)},
+		"humanized":   {data: `"1.5 MBps"`, expected: downloadRate(1500000)},
+		"infinity":    {data: `"+Inf bps"`, expected: downloadRate(math.Inf(1))},
+		"null":        {data: `null`, expected: downloadRate(0)},
+		"zero":        {data: `0`, expected: downloadRate(0)},
+		"zero string": {data: `"0Bps"`, expected: downloadRate(0)},
+		"leading dot": {data: `.5`, expected: downloadRate(.5)},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var dr downloadRate
+			err := dr.UnmarshalJSON([]byte(c.data))
+			require.NoError(t, err)
+			require.Equal(t, c.expected, dr)
+		})
+	}
+}
+
+func TestDownloadRateMarshalJSONRoundTrip(t *testing.T) {
+	cases := []downloadRate{
+		downloadRate(1536000),
+		downloadRate(0),
+		downloadRate(math.Inf(1)),
+	}
+
+	for _, dr := range cases {
+		data, err := dr.MarshalJSON()
+		require.NoError(t, err)
+
+		var roundTripped downloadRate
+		require.NoError(t, roundTripped.UnmarshalJSON(data))
+
+		if math.IsInf(float64(dr), 0) {
+			require.True(t, math.IsInf(float64(roundTripped), 0))
+			continue
+		}
+
+		// The humanized form keeps two significant digits, so e.g.
+		// 1536000 comes back as 1500000.
+		require.InDelta(t, float64(dr), float64(roundTripped), float64(dr)*0.05)
+	}
+}
+
+func TestDownloadRateMarshalJSONNumeric(t *testing.T) {
+	NumericDownloadRate = true
+	defer func() { NumericDownloadRate = false }()
+
+	dr := downloadRate(1536000)
+	data, err := dr.MarshalJSON()
+	require.NoError(t, err)
+	require.Equal(t, "1536000", string(data))
+
+	var roundTripped downloadRate
+	require.NoError(t, roundTripped.UnmarshalJSON(data))
+	require.Equal(t, dr, roundTripped)
+}
+
+func TestSetDownloadProgressETASeconds(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	// Neither percent nor rate set yet.
+	require.Nil(t, d.Metadata.DownloadETASeconds)
+
+	d.SetDownloadProgress(0.5, 1024)
+	require.NotNil(t, d.Metadata.DownloadETASeconds)
+	require.GreaterOrEqual(t, *d.Metadata.DownloadETASeconds, 0.0)
+
+	// A zero rate means we can't estimate an ETA.
+	d.SetDownloadProgress(0.5, 0)
+	require.Nil(t, d.Metadata.DownloadETASeconds)
+}
+
+func TestSetDownloadBytes(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	d.SetDownloadBytes(512, 2048)
+	require.EqualValues(t, 512, d.Metadata.DownloadBytesOffset)
+	require.EqualValues(t, 2048, d.Metadata.DownloadTotalBytes)
+}
+
+func TestMetadataJSONOmitsETAWhenUnset(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "eta_seconds")
+}
+
+func TestSubscribeDropsOldestWhenFull(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	ch, unsubscribe := d.Subscribe(1)
+	defer unsubscribe()
+
+	// Drain the initial notification sent on registration.
+	<-ch
+
+	d.SetDownloadProgress(0.1, 1024)
+	d.SetDownloadProgress(0.2, 1024)
+	d.SetDownloadProgress(0.3, 1024)
+
+	received := <-ch
+	require.Equal(t, 0.3, received.Metadata.DownloadPercent)
+}
+
+func TestSubscribeClosesOnCompleted(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	ch, unsubscribe := d.Subscribe(1)
+	defer unsubscribe()
+
+	<-ch // initial notification
+
+	d.SetState(StateCompleted)
+
+	_, ok := <-ch
+	require.False(t, ok)
+}
+
+func TestUnregisterObserverStopsNotifications(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	var notifications int
+	id := d.RegisterObserver(func(*Details) { notifications++ })
+	require.Equal(t, 1, notifications)
+
+	d.UnregisterObserver(id)
+	d.SetDownloadProgress(0.5, 1024)
+
+	require.Equal(t, 1, notifications)
+}
@@ -0,0 +1,197 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package details
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Journal persists every Details state transition to an append-only,
+// newline-delimited JSON file, so that an in-progress upgrade can be
+// resumed after the agent crashes or restarts instead of starting over or
+// being reported as failed. In particular, Metadata.DownloadBytesOffset and
+// Metadata.DownloadTotalBytes (set via SetDownloadBytes) let the caller
+// resume an interrupted download with an HTTP Range request starting at
+// the last recorded offset instead of re-downloading the whole artifact.
+//
+// A Journal is attached to a *Details with SetJournal; once attached,
+// SetState, SetDownloadProgress, SetDownloadBytes, Fail, Pause, Resume, and
+// Retry all record a new line.
+type Journal struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewJournal opens (creating if necessary) the journal file at path for
+// appending.
+func NewJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("creating journal directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal file %s: %w", path, err)
+	}
+
+	return &Journal{path: path, file: f}, nil
+}
+
+// Path returns the path of the underlying journal file, so it can be
+// surfaced through the control API for e.g. `elastic-agent status` to
+// display prior-attempt history.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Record appends the current state of d to the journal. Terminal states
+// (StateFailed, StateCompleted) are fsynced immediately, so the record of
+// how the upgrade ended survives a crash right after it happens, and
+// trigger compaction of earlier attempts.
+func (j *Journal) Record(d *Details) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("marshaling details for journal: %w", err)
+	}
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing to journal: %w", err)
+	}
+
+	if d.State != StateFailed && d.State != StateCompleted {
+		return nil
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("syncing journal: %w", err)
+	}
+
+	return j.compact()
+}
+
+// compact rewrites the journal file to retain only the records belonging
+// to the most recent upgrade attempt (identified by ActionID), so the
+// file doesn't grow without bound over the agent's lifetime.
+func (j *Journal) compact() error {
+	records, err := readJournalRecords(j.path)
+	if err != nil {
+		return fmt.Errorf("reading journal for compaction: %w", err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	latestActionID := records[len(records)-1].ActionID
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("creating compaction temp file: %w", err)
+	}
+
+	for _, r := range records {
+		if r.ActionID != latestActionID {
+			continue
+		}
+
+		data, err := json.Marshal(r)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("marshaling details during compaction: %w", err)
+		}
+		if _, err := tmp.Write(append(data, '\n')); err != nil {
+			tmp.Close()
+			return fmt.Errorf("writing compacted journal: %w", err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing compacted journal: %w", err)
+	}
+
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("closing journal before compaction swap: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("replacing journal with compacted copy: %w", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("reopening journal after compaction: %w", err)
+	}
+	j.file = f
+
+	return nil
+}
+
+// Close closes the underlying journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// LoadLatest reconstructs the most recently recorded *Details from the
+// journal at path, so the upgrader can resume an in-progress upgrade
+// after a crash or restart, including Metadata.FailedState and partial
+// download progress. It returns a nil *Details, with no error, if the
+// journal doesn't exist yet or has no records.
+func LoadLatest(path string) (*Details, error) {
+	records, err := readJournalRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return records[len(records)-1], nil
+}
+
+func readJournalRecords(path string) ([]*Details, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening journal file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var records []*Details
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var d Details
+		if err := json.Unmarshal(line, &d); err != nil {
+			return nil, fmt.Errorf("parsing journal record: %w", err)
+		}
+
+		records = append(records, &d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal file %s: %w", path, err)
+	}
+
+	return records, nil
+}
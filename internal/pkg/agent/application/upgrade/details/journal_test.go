@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package details
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalRecordAndLoadLatest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade-details.ndjson")
+
+	j, err := NewJournal(path)
+	require.NoError(t, err)
+
+	d := NewDetails("8.9.0", StateRequested, "action-id")
+	d.SetJournal(j)
+
+	d.SetState(StateDownloading)
+	d.SetDownloadProgress(0.5, 1024)
+	d.Fail(errBoom)
+	require.NoError(t, j.Close())
+
+	loaded, err := LoadLatest(path)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	require.Equal(t, StateFailed, loaded.State)
+	require.Equal(t, StateDownloading, loaded.Metadata.FailedState)
+	require.Equal(t, 0.5, loaded.Metadata.DownloadPercent)
+}
+
+func TestJournalRoundTripsDownloadBytesOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade-details.ndjson")
+
+	j, err := NewJournal(path)
+	require.NoError(t, err)
+
+	d := NewDetails("8.9.0", StateRequested, "action-id")
+	d.SetJournal(j)
+
+	d.SetState(StateDownloading)
+	d.SetDownloadBytes(512, 2048)
+	require.NoError(t, j.Close())
+
+	loaded, err := LoadLatest(path)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	require.EqualValues(t, 512, loaded.Metadata.DownloadBytesOffset, "offset must survive a reload so the download can resume with a Range request")
+	require.EqualValues(t, 2048, loaded.Metadata.DownloadTotalBytes)
+}
+
+func TestJournalRoundTripsPauseAcrossReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade-details.ndjson")
+
+	j, err := NewJournal(path)
+	require.NoError(t, err)
+
+	d := NewDetails("8.9.0", StateRequested, "action-id")
+	d.SetJournal(j)
+
+	d.SetState(StateDownloading)
+	d.Pause("outside maintenance window")
+	require.NoError(t, j.Close())
+
+	loaded, err := LoadLatest(path)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	require.Equal(t, StatePaused, loaded.State)
+	require.Equal(t, StateDownloading, loaded.Metadata.PrePauseState)
+
+	loaded.Resume()
+	require.Equal(t, StateDownloading, loaded.State, "Resume after a reload must restore the pre-pause state from the journal, not an empty one")
+}
+
+func TestJournalCompactionKeepsOnlyLatestAttempt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade-details.ndjson")
+
+	j, err := NewJournal(path)
+	require.NoError(t, err)
+
+	first := NewDetails("8.9.0", StateRequested, "first-attempt")
+	first.SetJournal(j)
+	first.Fail(errBoom)
+
+	second := NewDetails("8.9.0", StateRequested, "second-attempt")
+	second.SetJournal(j)
+	second.SetState(StateDownloading)
+	second.Fail(errBoom)
+	require.NoError(t, j.Close())
+
+	records, err := readJournalRecords(path)
+	require.NoError(t, err)
+	for _, r := range records {
+		require.Equal(t, "second-attempt", r.ActionID)
+	}
+}
+
+func TestLoadLatestMissingFile(t *testing.T) {
+	loaded, err := LoadLatest(filepath.Join(t.TempDir(), "does-not-exist.ndjson"))
+	require.NoError(t, err)
+	require.Nil(t, loaded)
+}
+
+type boomError struct{}
+
+func (boomError) Error() string { return "boom" }
+
+var errBoom = boomError{}
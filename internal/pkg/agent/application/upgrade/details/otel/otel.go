@@ -0,0 +1,269 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package otel implements a details.Observer that emits OpenTelemetry
+// metrics and spans for upgrade progress, giving operators visibility
+// into stuck downloads and failed upgrades across a fleet without
+// scraping each agent's local control socket.
+package otel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/elastic/elastic-agent-poc/elastic-agent/internal/pkg/agent/application/upgrade/details"
+)
+
+// Protocol selects the OTLP transport used to reach the configured
+// exporter endpoint.
+type Protocol string
+
+const (
+	// ProtocolGRPC exports over OTLP/gRPC. This is the default.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolHTTP exports over OTLP/HTTP.
+	ProtocolHTTP Protocol = "http"
+)
+
+// Config configures the exporter NewObserver wires up. It's sourced from
+// the agent's existing monitoring configuration.
+type Config struct {
+	// Endpoint is the OTLP collector endpoint, e.g. "localhost:4317".
+	Endpoint string
+
+	// Protocol selects gRPC or HTTP OTLP transport. Defaults to
+	// ProtocolGRPC.
+	Protocol Protocol
+
+	// Insecure disables TLS when dialing Endpoint.
+	Insecure bool
+
+	// ServiceVersion is recorded as the service.version resource
+	// attribute.
+	ServiceVersion string
+
+	// AgentID is recorded as the agent.id resource attribute.
+	AgentID string
+}
+
+// observer holds the instruments and per-upgrade state a single
+// details.Observer closure needs across notifications.
+type observer struct {
+	mu sync.Mutex
+
+	downloadPercent float64
+	downloadRate    float64
+
+	tracer       trace.Tracer
+	stateCounter metric.Int64Counter
+
+	span      trace.Span
+	lastState details.State
+}
+
+// NewObserver builds a details.Observer that emits:
+//   - an elastic_agent.upgrade.download.percent gauge
+//   - an elastic_agent.upgrade.download.rate_bps gauge
+//   - an elastic_agent.upgrade.state_transitions counter, labeled by
+//     from/to state
+//   - one span per upgrade, started on the first notification and ended
+//     when the upgrade completes or Metadata.FailedState is set
+//
+// Register the returned Observer with details.Details.RegisterObserver at
+// upgrader construction; no other core code changes are needed. The
+// returned shutdown function flushes and closes the exporters and should
+// be deferred by whoever owns the Details' lifetime.
+func NewObserver(ctx context.Context, cfg Config) (observerFn details.Observer, shutdown func(context.Context) error, err error) {
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("elastic-agent"),
+			semconv.ServiceVersionKey.String(cfg.ServiceVersion),
+			attribute.String("agent.id", cfg.AgentID),
+		),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("merging otel resource: %w", err)
+	}
+
+	metricExporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating otel metric exporter: %w", err)
+	}
+
+	traceExporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating otel trace exporter: %w", err)
+	}
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+	)
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(traceExporter),
+	)
+
+	// From here on, any returned error must shut down the providers built
+	// above first; otherwise their background export goroutines and
+	// connections leak since the caller never receives a shutdown func to
+	// call instead.
+	shutdownProviders := func(ctx context.Context) error {
+		err := tracerProvider.Shutdown(ctx)
+		if mErr := meterProvider.Shutdown(ctx); mErr != nil && err == nil {
+			err = mErr
+		}
+		return err
+	}
+
+	meter := meterProvider.Meter("elastic-agent/upgrade")
+	o := &observer{tracer: tracerProvider.Tracer("elastic-agent/upgrade")}
+
+	if _, err := meter.Float64ObservableGauge(
+		"elastic_agent.upgrade.download.percent",
+		metric.WithDescription("Fraction of the upgrade artifact downloaded so far"),
+		metric.WithFloat64Callback(func(_ context.Context, obs metric.Float64Observer) error {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			obs.Observe(o.downloadPercent)
+			return nil
+		}),
+	); err != nil {
+		_ = shutdownProviders(ctx)
+		return nil, nil, fmt.Errorf("registering download percent gauge: %w", err)
+	}
+
+	if _, err := meter.Float64ObservableGauge(
+		"elastic_agent.upgrade.download.rate_bps",
+		metric.WithDescription("Current upgrade artifact download rate, in bytes/second"),
+		metric.WithFloat64Callback(func(_ context.Context, obs metric.Float64Observer) error {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			obs.Observe(o.downloadRate)
+			return nil
+		}),
+	); err != nil {
+		_ = shutdownProviders(ctx)
+		return nil, nil, fmt.Errorf("registering download rate gauge: %w", err)
+	}
+
+	stateCounter, err := meter.Int64Counter(
+		"elastic_agent.upgrade.state_transitions",
+		metric.WithDescription("Count of upgrade state transitions, labeled by from/to state"),
+	)
+	if err != nil {
+		_ = shutdownProviders(ctx)
+		return nil, nil, fmt.Errorf("registering state transition counter: %w", err)
+	}
+	o.stateCounter = stateCounter
+
+	shutdown = func(ctx context.Context) error {
+		if err := shutdownProviders(ctx); err != nil {
+			return fmt.Errorf("shutting down otel providers: %w", err)
+		}
+		return nil
+	}
+
+	return o.observe, shutdown, nil
+}
+
+func (o *observer) observe(d *details.Details) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ctx := context.Background()
+
+	if d == nil {
+		o.endSpan(nil)
+		return
+	}
+
+	if o.span == nil {
+		_, span := o.tracer.Start(ctx, "elastic-agent.upgrade", trace.WithAttributes(
+			attribute.String("upgrade.target_version", d.TargetVersion),
+			attribute.String("upgrade.action_id", d.ActionID),
+		))
+		o.span = span
+		o.lastState = d.State
+	}
+
+	if d.State != o.lastState {
+		o.stateCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("from", string(o.lastState)),
+			attribute.String("to", string(d.State)),
+		))
+		o.lastState = d.State
+	}
+
+	o.downloadPercent = d.Metadata.DownloadPercent
+	o.downloadRate = float64(d.Metadata.DownloadRate)
+
+	if d.Metadata.FailedState != "" {
+		o.span.AddEvent("upgrade.failed", trace.WithAttributes(
+			attribute.String("error_msg", d.Metadata.ErrorMsg),
+		))
+		o.endSpan(fmt.Errorf("%s", d.Metadata.ErrorMsg))
+	}
+}
+
+// endSpan ends the current span, if any, recording err on it first.
+// Callers must hold o.mu.
+func (o *observer) endSpan(err error) {
+	if o.span == nil {
+		return
+	}
+
+	if err != nil {
+		o.span.RecordError(err)
+	}
+	o.span.End()
+	o.span = nil
+}
+
+func newMetricExporter(ctx context.Context, cfg Config) (sdkmetric.Exporter, error) {
+	if cfg.Protocol == ProtocolHTTP {
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+func newTraceExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	if cfg.Protocol == ProtocolHTTP {
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	return otlptracegrpc.New(ctx, opts...)
+}
@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package details
+
+import "time"
+
+// StatePaused indicates the upgrade has been explicitly paused, e.g.
+// because the agent is outside of a maintenance window. See Details.Pause.
+const StatePaused State = "UPG_PAUSED"
+
+// StateRetrying indicates a previously failed upgrade is waiting to retry
+// after a transient error. See Details.Retry and RetryPolicy.
+const StateRetrying State = "UPG_RETRYING"
+
+// RetryRecord records a single retry attempt for an upgrade that failed
+// and was retried.
+type RetryRecord struct {
+	Attempt int       `json:"attempt" yaml:"attempt"`
+	Error   string    `json:"error,omitempty" yaml:"error,omitempty"`
+	RetryAt time.Time `json:"retry_at" yaml:"retry_at"`
+}
+
+// RetryPolicy bounds how many times, and how fast, an upgrade may
+// automatically retry after Fail is called instead of going straight to
+// StateFailed. Attach one with Details.SetRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of retries Fail will allow before
+	// giving up and transitioning to StateFailed. Zero means Fail always
+	// goes straight to StateFailed.
+	MaxAttempts int
+
+	// BackoffBase is the base duration for exponential backoff: the Nth
+	// retry is scheduled BackoffBase * 2^(N-1) after the failure.
+	BackoffBase time.Duration
+}
+
+// nextRetryAt returns when attempt should begin, per exponential backoff
+// from p.BackoffBase.
+func (p RetryPolicy) nextRetryAt(attempt int) time.Time {
+	return time.Now().Add(p.BackoffBase * (1 << (attempt - 1)))
+}
+
+// SetRetryPolicy attaches a RetryPolicy that Fail will consult to decide
+// whether to transition to StateRetrying instead of StateFailed.
+func (d *Details) SetRetryPolicy(policy RetryPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.retryPolicy = &policy
+}
+
+// Pause transitions the upgrade to StatePaused, recording reason, and
+// notifies observers. Call Resume to continue the upgrade from the state
+// it was in when Pause was called. Pause is idempotent: calling it again
+// while already paused only updates reason, it does not overwrite the
+// state Resume will restore.
+func (d *Details) Pause(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.State != StatePaused {
+		d.Metadata.PrePauseState = d.State
+	}
+	d.Metadata.PauseReason = reason
+	d.State = StatePaused
+
+	d.recordToJournal()
+	d.notifyObservers()
+}
+
+// Resume transitions the upgrade out of StatePaused, back to whatever
+// state it was in when Pause was called, and clears PauseReason.
+func (d *Details) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.State = d.Metadata.PrePauseState
+	d.Metadata.PauseReason = ""
+
+	// The pause may have lasted an arbitrary amount of time (the whole
+	// point of Pause, e.g. "outside maintenance window"); forget when the
+	// download started so a subsequent SetDownloadProgress recomputes
+	// DownloadETASeconds from scratch instead of including the pause in
+	// the elapsed time, the same way retry() does after a retry.
+	d.downloadStarted = time.Time{}
+
+	d.recordToJournal()
+	d.notifyObservers()
+}
+
+// Retry transitions the upgrade to StateRetrying, recording attempt and
+// nextAt, and appends a RetryRecord to Metadata.RetryHistory. Call this
+// directly for an explicit, operator-triggered retry; Fail calls it
+// automatically when an attached RetryPolicy allows another attempt.
+func (d *Details) Retry(attempt int, nextAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.retry(attempt, nextAt, d.Metadata.ErrorMsg)
+}
+
+// retry is the shared implementation behind Retry and Fail's automatic
+// retry path. Callers must hold d.mu.
+func (d *Details) retry(attempt int, nextAt time.Time, errMsg string) {
+	d.Metadata.RetryAttempt = attempt
+	d.Metadata.RetryAt = &nextAt
+	d.Metadata.RetryHistory = append(d.Metadata.RetryHistory, RetryRecord{
+		Attempt: attempt,
+		Error:   errMsg,
+		RetryAt: nextAt,
+	})
+	d.State = StateRetrying
+
+	// StateRetrying is not a terminal state, so clear FailedState/ErrorMsg
+	// the same way SetState does for any other non-StateFailed
+	// transition; otherwise a retryable Fail would leave FailedState set
+	// while State == StateRetrying, which looks like a terminal failure
+	// to anything checking FailedState != "".
+	d.Metadata.FailedState = ""
+	d.Metadata.ErrorMsg = ""
+
+	// The upcoming attempt is a fresh download; forget when the previous
+	// attempt started so SetDownloadProgress recomputes
+	// DownloadETASeconds from scratch instead of including the failed
+	// attempt and backoff wait in the elapsed time.
+	d.downloadStarted = time.Time{}
+
+	d.recordToJournal()
+	d.notifyObservers()
+}
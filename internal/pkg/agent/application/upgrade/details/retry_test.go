@@ -0,0 +1,113 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package details
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseResume(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	d.Pause("outside maintenance window")
+	require.Equal(t, StatePaused, d.State)
+	require.Equal(t, "outside maintenance window", d.Metadata.PauseReason)
+
+	d.Resume()
+	require.Equal(t, StateDownloading, d.State)
+	require.Empty(t, d.Metadata.PauseReason)
+}
+
+func TestPauseIsIdempotent(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	d.Pause("first check")
+	d.Pause("second check")
+	require.Equal(t, StatePaused, d.State)
+	require.Equal(t, "second check", d.Metadata.PauseReason)
+
+	d.Resume()
+	require.Equal(t, StateDownloading, d.State, "Resume must restore the state from before the first Pause, not StatePaused")
+}
+
+func TestRetryRecordsHistory(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	nextAt := time.Now().Add(time.Minute)
+	d.Retry(1, nextAt)
+
+	require.Equal(t, StateRetrying, d.State)
+	require.Equal(t, 1, d.Metadata.RetryAttempt)
+	require.Len(t, d.Metadata.RetryHistory, 1)
+	require.Equal(t, 1, d.Metadata.RetryHistory[0].Attempt)
+
+	d.SetState(StateDownloading)
+	d.Retry(2, nextAt.Add(time.Minute))
+
+	require.Len(t, d.Metadata.RetryHistory, 2, "RetryHistory should accumulate across retries")
+}
+
+func TestRetryHistoryNotClearedBySetState(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	d.Retry(1, time.Now().Add(time.Minute))
+	require.Len(t, d.Metadata.RetryHistory, 1)
+
+	// SetState clears FailedState/ErrorMsg for non-terminal transitions,
+	// but must not clear RetryHistory.
+	d.SetState(StateDownloading)
+	require.Len(t, d.Metadata.RetryHistory, 1)
+}
+
+func TestFailRetriesWithinPolicy(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+	d.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BackoffBase: time.Second})
+
+	d.Fail(errors.New("transient network error"))
+	require.Equal(t, StateRetrying, d.State)
+	require.Equal(t, 1, d.Metadata.RetryAttempt)
+	require.Len(t, d.Metadata.RetryHistory, 1)
+	require.Empty(t, d.Metadata.FailedState, "a retryable Fail is not a terminal failure, FailedState must stay unset")
+	require.Empty(t, d.Metadata.ErrorMsg, "a retryable Fail is not a terminal failure, ErrorMsg must stay unset")
+
+	d.Fail(errors.New("transient network error again"))
+	require.Equal(t, StateRetrying, d.State)
+	require.Equal(t, 2, d.Metadata.RetryAttempt)
+	require.Len(t, d.Metadata.RetryHistory, 2)
+	require.Empty(t, d.Metadata.FailedState)
+
+	// Policy exhausted: the third failure should go straight to StateFailed.
+	d.Fail(errors.New("out of attempts"))
+	require.Equal(t, StateFailed, d.State)
+	require.Len(t, d.Metadata.RetryHistory, 2, "RetryHistory shouldn't grow once the policy is exhausted")
+	require.Equal(t, StateRetrying, d.Metadata.FailedState, "the terminal failure should record the state it failed from")
+	require.Equal(t, "out of attempts", d.Metadata.ErrorMsg)
+}
+
+func TestRetryResetsDownloadStartedForETA(t *testing.T) {
+	d := NewDetails("8.9.0", StateDownloading, "action-id")
+
+	d.SetDownloadProgress(0.1, 1024)
+	firstETA := d.Metadata.DownloadETASeconds
+	require.NotNil(t, firstETA)
+
+	d.SetRetryPolicy(RetryPolicy{MaxAttempts: 1, BackoffBase: time.Millisecond})
+	d.Fail(errors.New("transient error"))
+	require.Equal(t, StateRetrying, d.State)
+
+	d.SetState(StateDownloading)
+	d.SetDownloadProgress(0.1, 1024)
+
+	// The retried attempt's ETA should be computed from a freshly reset
+	// start time, not include the elapsed time from the failed attempt
+	// plus backoff wait, so it should look like a brand new download
+	// rather than a growing one.
+	require.NotNil(t, d.Metadata.DownloadETASeconds)
+	require.InDelta(t, *firstETA, *d.Metadata.DownloadETASeconds, 1)
+}